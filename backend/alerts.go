@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// AlertRuleType is the kind of condition an Alert watches for.
+type AlertRuleType string
+
+const (
+	// AlertAbsolutePrice fires when the price drops at or below Threshold.
+	AlertAbsolutePrice AlertRuleType = "absolute_price"
+	// AlertPercentDrop fires when the price drops by at least Threshold
+	// percent from the trailing 7-day moving average.
+	AlertPercentDrop AlertRuleType = "percent_drop"
+	// AlertAllTimeLow fires when the price is a new low over the tracked
+	// history.
+	AlertAllTimeLow AlertRuleType = "all_time_low"
+)
+
+// Alert is a user-defined rule that fires a notification when a product's
+// price crosses a threshold. Cooldown prevents re-firing on flapping prices.
+type Alert struct {
+	UserID     string        `bson:"user_id"`
+	ProductURL string        `bson:"product_url"`
+	RuleType   AlertRuleType `bson:"rule_type"`
+	Threshold  float64       `bson:"threshold"`
+	Cooldown   time.Duration `bson:"cooldown"`
+	LastFired  time.Time     `bson:"last_fired"`
+
+	// AllTimeLow and HasAllTimeLow track the lowest price seen so far for
+	// AllTimeLow alerts. This is persisted state rather than re-derived from
+	// GetPriceHistory on every check: once DownsamplePrices rolls old raw
+	// points into hourly buckets, a raw-only history read can no longer see
+	// the true historic low, so the running minimum is the source of truth.
+	AllTimeLow    float64 `bson:"all_time_low"`
+	HasAllTimeLow bool    `bson:"has_all_time_low"`
+}
+
+// Notifier delivers a fired Alert to some external sink (email, chat,
+// webhook, ...). Implementations should be safe to share across alerts.
+type Notifier interface {
+	Notify(ctx context.Context, alert Alert, productName string, price float64) error
+}
+
+func newAlertsCollection(ctx context.Context, database *mongo.Database) (MongoCollection, error) {
+	collection := database.Collection("alerts")
+	_, err := collection.Indexes().CreateOne(
+		ctx,
+		mongo.IndexModel{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "product_url", Value: 1}},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return collection, nil
+}
+
+// notifyWorkers is how many goroutines deliver notifications concurrently.
+// notifyQueueSize bounds how many fired alerts can be queued for delivery
+// before Evaluate starts dropping them instead of blocking its caller.
+const (
+	notifyWorkers   = 4
+	notifyQueueSize = 256
+)
+
+// pendingNotification is a fired alert queued for asynchronous delivery.
+type pendingNotification struct {
+	alert       Alert
+	productName string
+	price       float64
+}
+
+// AlertEvaluator checks a product's new price against its stored Alerts
+// after each successful scrape and notifies any that fire. Notifications are
+// delivered on a background worker pool rather than inline in Evaluate: a
+// slow or hung Notifier (SMTPNotifier.Notify ignores its ctx entirely, since
+// smtp.SendMail has no cancellation) must not stall the refresh pipeline's
+// single collector goroutine, which would in turn block every scrapeWorker.
+type AlertEvaluator struct {
+	store    *MongoDB
+	notifier Notifier
+	pending  chan pendingNotification
+}
+
+// NewAlertEvaluator builds an evaluator that delivers fired alerts through
+// notifier on a background worker pool, decoupled from Evaluate's caller.
+func NewAlertEvaluator(store *MongoDB, notifier Notifier) *AlertEvaluator {
+	e := &AlertEvaluator{
+		store:    store,
+		notifier: notifier,
+		pending:  make(chan pendingNotification, notifyQueueSize),
+	}
+	for i := 0; i < notifyWorkers; i++ {
+		go e.deliverNotifications()
+	}
+	return e
+}
+
+// deliverNotifications drains pending notifications for the life of the
+// process: pending is never closed, so these goroutines never exit (unlike
+// the refresh worker pool, whose workers exit once their jobs channel closes).
+func (e *AlertEvaluator) deliverNotifications() {
+	for n := range e.pending {
+		if err := e.notifier.Notify(context.Background(), n.alert, n.productName, n.price); err != nil {
+			log.Printf("Error delivering alert notification for %s: %v\n", n.alert.ProductURL, err)
+		}
+	}
+}
+
+// dispatch queues a fired alert for delivery without blocking: if the queue
+// is full (the notifier can't keep up), the notification is dropped and
+// logged rather than stalling the caller.
+func (e *AlertEvaluator) dispatch(alert Alert, productName string, price float64) {
+	select {
+	case e.pending <- pendingNotification{alert: alert, productName: productName, price: price}:
+	default:
+		log.Printf("Dropping alert notification for %s: notifier queue full\n", alert.ProductURL)
+	}
+}
+
+// Evaluate loads userID's alerts for productURL and notifies any whose rule
+// matches the new price, respecting each alert's cooldown.
+func (e *AlertEvaluator) Evaluate(ctx context.Context, userID, productURL, productName string, price float64) error {
+	cursor, err := e.store.alertsCollection.Find(ctx, bson.M{"user_id": userID, "product_url": productURL})
+	if err != nil {
+		return fmt.Errorf("failed to load alerts for %s: %v", productURL, err)
+	}
+	defer cursor.Close(ctx)
+
+	var alerts []Alert
+	for cursor.Next(ctx) {
+		var alert Alert
+		if err := cursor.Decode(&alert); err != nil {
+			return fmt.Errorf("error decoding alert: %v", err)
+		}
+		alerts = append(alerts, alert)
+	}
+
+	for _, alert := range alerts {
+		if time.Since(alert.LastFired) < alert.Cooldown {
+			// A new low seen during cooldown still advances the running low,
+			// so it isn't mistaken for a new all-time low once cooldown ends.
+			if alert.RuleType == AlertAllTimeLow && (!alert.HasAllTimeLow || price < alert.AllTimeLow) {
+				_, err := e.store.alertsCollection.UpdateOne(ctx,
+					bson.M{"user_id": alert.UserID, "product_url": alert.ProductURL, "rule_type": alert.RuleType, "threshold": alert.Threshold},
+					bson.M{"$set": bson.M{"all_time_low": price, "has_all_time_low": true}},
+				)
+				if err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		matched, err := e.matches(ctx, alert, productURL, price)
+		if err != nil {
+			return err
+		}
+		if !matched {
+			continue
+		}
+
+		// markFired records the crossing before delivery is attempted: once
+		// dispatch hands the notification to the background workers, Evaluate
+		// has no way to learn whether it ultimately succeeds, so there's
+		// nothing to condition markFired on.
+		if err := e.markFired(ctx, alert, price); err != nil {
+			return err
+		}
+		e.dispatch(alert, productName, price)
+	}
+
+	return nil
+}
+
+func (e *AlertEvaluator) matches(ctx context.Context, alert Alert, productURL string, price float64) (bool, error) {
+	switch alert.RuleType {
+	case AlertAbsolutePrice:
+		return price <= alert.Threshold, nil
+
+	case AlertPercentDrop:
+		avg, err := e.movingAverage(ctx, productURL, 7*24*time.Hour)
+		if err != nil || avg == 0 {
+			return false, err
+		}
+		drop := (avg - price) / avg * 100
+		return drop >= alert.Threshold, nil
+
+	case AlertAllTimeLow:
+		return !alert.HasAllTimeLow || price < alert.AllTimeLow, nil
+
+	default:
+		return false, nil
+	}
+}
+
+func (e *AlertEvaluator) movingAverage(ctx context.Context, productURL string, window time.Duration) (float64, error) {
+	points, err := e.store.GetPriceHistory(ctx, productURL, time.Now().Add(-window), time.Now(), GranularityRaw)
+	if err != nil || len(points) == 0 {
+		return 0, err
+	}
+	var sum float64
+	for _, p := range points {
+		sum += p.Value
+	}
+	return sum / float64(len(points)), nil
+}
+
+// markFired persists LastFired atomically with $set so a restart mid-run
+// doesn't re-notify on the same crossing. For AllTimeLow alerts it also
+// advances the stored running low to price, since matches already confirmed
+// price is a new low. The filter includes threshold alongside rule_type so
+// two alerts of the same type on the same product (e.g. two absolute_price
+// alerts at different thresholds) target their own document instead of
+// whichever one UpdateOne happens to match first.
+func (e *AlertEvaluator) markFired(ctx context.Context, alert Alert, price float64) error {
+	set := bson.M{"last_fired": time.Now()}
+	if alert.RuleType == AlertAllTimeLow {
+		set["all_time_low"] = price
+		set["has_all_time_low"] = true
+	}
+
+	_, err := e.store.alertsCollection.UpdateOne(ctx,
+		bson.M{
+			"user_id":     alert.UserID,
+			"product_url": alert.ProductURL,
+			"rule_type":   alert.RuleType,
+			"threshold":   alert.Threshold,
+		},
+		bson.M{"$set": set},
+	)
+	return err
+}
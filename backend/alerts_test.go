@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestAlertEvaluatorMatchesAllTimeLow(t *testing.T) {
+	e := &AlertEvaluator{}
+	alert := Alert{RuleType: AlertAllTimeLow}
+
+	matched, err := e.matches(context.Background(), alert, "http://example.com/p", 100)
+	if err != nil {
+		t.Fatalf("matches returned error: %v", err)
+	}
+	if !matched {
+		t.Fatalf("first price ever seen should count as a new all-time low")
+	}
+
+	alert.HasAllTimeLow = true
+	alert.AllTimeLow = 100
+
+	matched, err = e.matches(context.Background(), alert, "http://example.com/p", 120)
+	if err != nil {
+		t.Fatalf("matches returned error: %v", err)
+	}
+	if matched {
+		t.Fatalf("a price above the stored low must not be flagged as a new low")
+	}
+
+	matched, err = e.matches(context.Background(), alert, "http://example.com/p", 80)
+	if err != nil {
+		t.Fatalf("matches returned error: %v", err)
+	}
+	if !matched {
+		t.Fatalf("a price below the stored low must be flagged as a new low")
+	}
+}
+
+func TestAlertEvaluatorMatchesAbsolutePrice(t *testing.T) {
+	e := &AlertEvaluator{}
+	alert := Alert{RuleType: AlertAbsolutePrice, Threshold: 50}
+
+	matched, err := e.matches(context.Background(), alert, "http://example.com/p", 49.99)
+	if err != nil {
+		t.Fatalf("matches returned error: %v", err)
+	}
+	if !matched {
+		t.Fatalf("price at or below threshold should match")
+	}
+
+	matched, err = e.matches(context.Background(), alert, "http://example.com/p", 50.01)
+	if err != nil {
+		t.Fatalf("matches returned error: %v", err)
+	}
+	if matched {
+		t.Fatalf("price above threshold should not match")
+	}
+}
+
+// TestMarkFiredFiltersByThreshold guards the fix in dd31dc7: two alerts of
+// the same rule_type on the same product must update their own document,
+// not whichever one UpdateOne's filter happens to match first.
+func TestMarkFiredFiltersByThreshold(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("filters on the firing alert's own threshold", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse())
+
+		e := &AlertEvaluator{store: &MongoDB{alertsCollection: mt.Coll}}
+
+		low := Alert{UserID: "u1", ProductURL: "http://example.com/p", RuleType: AlertAbsolutePrice, Threshold: 10}
+		high := Alert{UserID: "u1", ProductURL: "http://example.com/p", RuleType: AlertAbsolutePrice, Threshold: 20}
+
+		if err := e.markFired(context.Background(), low, 9); err != nil {
+			t.Fatalf("markFired returned error: %v", err)
+		}
+		assertUpdateFilterThreshold(t, mt, 10)
+
+		if err := e.markFired(context.Background(), high, 19); err != nil {
+			t.Fatalf("markFired returned error: %v", err)
+		}
+		assertUpdateFilterThreshold(t, mt, 20)
+	})
+}
+
+// assertUpdateFilterThreshold checks the most recently sent update command's
+// filter scoped to the given threshold.
+func assertUpdateFilterThreshold(t *testing.T, mt *mtest.T, want float64) {
+	t.Helper()
+
+	evt := mt.GetStartedEvent()
+	if evt == nil || evt.CommandName != "update" {
+		t.Fatalf("expected an update command, got %+v", evt)
+	}
+
+	updates, err := evt.Command.Lookup("updates").Array().Values()
+	if err != nil || len(updates) != 1 {
+		t.Fatalf("expected exactly one update in the updates array, err=%v", err)
+	}
+
+	filter, err := updates[0].Document().LookupErr("q")
+	if err != nil {
+		t.Fatalf("update is missing its filter (q): %v", err)
+	}
+	threshold, err := filter.Document().LookupErr("threshold")
+	if err != nil {
+		t.Fatalf("update filter is missing threshold: %v", filter)
+	}
+	if got, ok := threshold.DoubleOK(); !ok || got != want {
+		t.Fatalf("expected filter threshold %v, got %v (ok=%v)", want, got, ok)
+	}
+}
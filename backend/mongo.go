@@ -4,8 +4,6 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"strconv"
-	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -13,45 +11,69 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// Price is a single point in a product's legacy embedded price history, from
+// before price points moved into the separate "prices" time-series
+// collection (see AddPrice/GetPriceHistory).
 type Price struct {
 	Value     float64   `bson:"value"`
 	Timestamp time.Time `bson:"timestamp"`
 }
 
 type Product struct {
+	UserID         string   `bson:"user_id"`
 	ProductURL     string   `bson:"product_url"`
 	ProductName    string   `bson:"product_name"`
 	ImageURL       string   `bson:"image_url"`
 	Specifications []string `bson:"specifications"`
-	PriceHistory   []Price  `bson:"price_history"`
+	// PriceHistory only exists so MigratePriceHistory can decode a
+	// pre-migration document's embedded array and seed the prices
+	// collection from it. The only writer left is MigrateToMultiTenant, which
+	// carries a legacy document's array over as-is; MigratePriceHistory
+	// unsets it once a product has been migrated.
+	PriceHistory []Price `bson:"price_history,omitempty"`
 }
 
 type MongoDB struct {
-	client     *mongo.Client
-	database   *mongo.Database
-	collection *mongo.Collection
+	client           *mongo.Client
+	database         *mongo.Database
+	collection       MongoCollection
+	usersCollection  MongoCollection
+	pricesCollection MongoCollection
+	alertsCollection MongoCollection
+	alertEvaluator   *AlertEvaluator
 }
 
-func NewMongoDB(uri string, username string) (*MongoDB, error) {
-	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI(uri))
+// SetAlertEvaluator wires an AlertEvaluator into the price-refresh pipeline.
+// UpdatePrices is a no-op for alerting until this is called.
+func (m *MongoDB) SetAlertEvaluator(e *AlertEvaluator) {
+	m.alertEvaluator = e
+}
+
+// NewMongoDB connects to uri and returns a store backed by a single shared
+// "products" collection, rather than one collection per user.
+func NewMongoDB(ctx context.Context, uri string) (*MongoDB, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
 	if err != nil {
 		return nil, err
 	}
 
 	// Ping the database to verify connection
-	err = client.Ping(context.Background(), nil)
+	err = client.Ping(ctx, nil)
 	if err != nil {
 		return nil, err
 	}
 
 	database := client.Database("price_tracker")
-	collection := database.Collection(username)
+	collection := database.Collection("products")
 
-	// Create indexes
+	// Create indexes. The unique key is (user_id, product_url) rather than
+	// product_url alone, since the same product can now be tracked by many
+	// users in one collection.
 	_, err = collection.Indexes().CreateOne(
-		context.Background(),
+		ctx,
 		mongo.IndexModel{
 			Keys: bson.D{
+				{Key: "user_id", Value: 1},
 				{Key: "product_url", Value: 1},
 			},
 			Options: options.Index().SetUnique(true),
@@ -61,59 +83,68 @@ func NewMongoDB(uri string, username string) (*MongoDB, error) {
 		return nil, err
 	}
 
-	return &MongoDB{
-		client:     client,
-		database:   database,
-		collection: collection,
-	}, nil
-}
-
-func (m *MongoDB) UpsertProduct(product *Product) error {
-	// 1. Check for existing product
-	var existingProduct Product
-	err := m.collection.FindOne(
-		context.Background(),
-		bson.M{"product_url": product.ProductURL},
-	).Decode(&existingProduct)
+	usersCollection, err := newUsersCollection(ctx, database)
+	if err != nil {
+		return nil, err
+	}
 
-	// 2. Handle the error check
-	if err != nil && err != mongo.ErrNoDocuments {
-		return fmt.Errorf("error checking existing product: %v", err)
+	pricesCollection, err := newPricesCollection(ctx, database)
+	if err != nil {
+		return nil, err
 	}
 
-	// 3. Preserve price history if product exists
-	if err != mongo.ErrNoDocuments {
-		product.PriceHistory = existingProduct.PriceHistory
+	alertsCollection, err := newAlertsCollection(ctx, database)
+	if err != nil {
+		return nil, err
 	}
 
-	// 4. Perform the upsert operation
-	filter := bson.M{"product_url": product.ProductURL}
+	return &MongoDB{
+		client:           client,
+		database:         database,
+		collection:       collection,
+		usersCollection:  usersCollection,
+		pricesCollection: pricesCollection,
+		alertsCollection: alertsCollection,
+	}, nil
+}
+
+// UpsertProduct inserts or updates userID's record for product, keyed by
+// (user_id, product_url). Price history lives in the separate prices
+// collection (see AddPrice/GetPriceHistory), not on the product document, so
+// this is a plain upsert with no need to read the existing document first.
+func (m *MongoDB) UpsertProduct(ctx context.Context, userID string, product *Product) error {
+	product.UserID = userID
+
+	filter := bson.M{"user_id": userID, "product_url": product.ProductURL}
 	update := bson.M{"$set": product}
 	opts := options.Update().SetUpsert(true)
 
-	_, err = m.collection.UpdateOne(context.Background(), filter, update, opts)
+	_, err := m.collection.UpdateOne(ctx, filter, update, opts)
 	return err
 }
 
-func (m *MongoDB) AddPrice(productURL string, price float64) error {
-	newPrice := Price{
-		Value:     price,
-		Timestamp: time.Now(),
+// AddPrice records a price point in the "prices" time-series collection,
+// keyed by (product_url, timestamp) rather than appending to the product
+// document. Price history is intentionally not scoped by user: the price of
+// a given URL is a vendor-level fact shared by every user tracking it.
+func (m *MongoDB) AddPrice(ctx context.Context, productURL string, price float64) error {
+	rec := priceRecord{
+		ProductURL:  productURL,
+		Value:       price,
+		Timestamp:   time.Now(),
+		Granularity: GranularityRaw,
 	}
 
-	filter := bson.M{"product_url": productURL}
-	update := bson.M{"$push": bson.M{"price_history": newPrice}}
-
-	_, err := m.collection.UpdateOne(context.Background(), filter, update)
+	_, err := m.pricesCollection.InsertOne(ctx, rec)
 	return err
 }
 
-func (m *MongoDB) GetProduct(productURL string) (*Product, error) {
+func (m *MongoDB) GetProduct(ctx context.Context, userID, productURL string) (*Product, error) {
 	var product Product
 
 	err := m.collection.FindOne(
-		context.Background(),
-		bson.M{"product_url": productURL},
+		ctx,
+		bson.M{"user_id": userID, "product_url": productURL},
 	).Decode(&product)
 
 	if err != nil {
@@ -122,113 +153,30 @@ func (m *MongoDB) GetProduct(productURL string) (*Product, error) {
 	return &product, nil
 }
 
-func (m *MongoDB) Close() {
-	m.client.Disconnect(context.Background())
-}
-
-func (m *MongoDB) UpdatePrices() error {
-	// Get all products
-	cursor, err := m.collection.Find(context.Background(), bson.M{})
+// ListProducts returns every product userID tracks.
+func (m *MongoDB) ListProducts(ctx context.Context, userID string) ([]*Product, error) {
+	cursor, err := m.collection.Find(ctx, bson.M{"user_id": userID})
 	if err != nil {
-		return fmt.Errorf("failed to find products: %v", err)
+		return nil, fmt.Errorf("failed to find products: %v", err)
 	}
-	defer cursor.Close(context.Background())
+	defer cursor.Close(ctx)
 
-	for cursor.Next(context.Background()) {
+	var products []*Product
+	for cursor.Next(ctx) {
 		var product Product
 		if err := cursor.Decode(&product); err != nil {
-			log.Printf("Error decoding product: %v\n", err)
-			continue
-		}
-
-		// Get current price based on URL
-		var currentPrice float64
-		var err error
-
-		if strings.Contains(product.ProductURL, "flipkart") {
-			priceStr, err := ScrapePriceFlipkart(product.ProductURL)
-			if err != nil {
-				log.Printf("Error scraping Flipkart price for %s: %v\n", product.ProductURL, err)
-				continue
-			}
-			currentPrice, err = strconv.ParseFloat(priceStr, 64)
-			if err != nil {
-				log.Printf("Error parsing price %s: %v\n", priceStr, err)
-				continue
-			}
-		} else if strings.Contains(product.ProductURL, "amazon") {
-			priceStr, err := ScrapePriceAmazon(product.ProductURL)
-			if err != nil {
-				log.Printf("Error scraping Amazon price for %s: %v\n", product.ProductURL, err)
-				continue
-			}
-			currentPrice, err = strconv.ParseFloat(priceStr, 64)
-			if err != nil {
-				log.Printf("Error parsing price %s: %v\n", priceStr, err)
-				continue
-			}
-		} else {
-			log.Printf("Unsupported vendor for URL: %s\n", product.ProductURL)
-			continue
-		}
-
-		// Create new price entry
-		newPrice := Price{
-			Value:     currentPrice,
-			Timestamp: time.Now(),
-		}
-
-		// Update the product with new price
-		update := bson.M{
-			"$push": bson.M{
-				"price_history": newPrice,
-			},
+			return nil, fmt.Errorf("error decoding product: %v", err)
 		}
-
-		_, err = m.collection.UpdateOne(
-			context.Background(),
-			bson.M{"product_url": product.ProductURL},
-			update,
-		)
-		if err != nil {
-			log.Printf("Error updating price for %s: %v\n", product.ProductURL, err)
-			continue
-		}
-
-		fmt.Printf("Updated price for %s: %.2f\n", product.ProductName, currentPrice)
+		products = append(products, &product)
 	}
-
-	return nil
+	return products, cursor.Err()
 }
 
-// // Optionally verify updates
-// products, err := db.GetAllProducts()
-// if err != nil {
-// 	log.Fatalf("Failed to get products: %v", err)
-// }
-
-// 	fmt.Printf("\nVerifying price updates for %d products:\n", len(products))
-// 	for _, product := range products {
-// 		if len(product.PriceHistory) > 0 {
-// 			latestPrice := product.PriceHistory[len(product.PriceHistory)-1]
-// 			fmt.Printf("%s: Latest price %.2f at %s\n",
-// 				product.ProductName,
-// 				latestPrice.Value,
-// 				latestPrice.Timestamp.Format(time.RFC3339))
-// 		}
-// 	}
-// }
-
-func (m *MongoDB) UpdateIncompleteRecords() error {
-
-	db, err := NewMongoDB(MongoURI, "cypher")
-	if err != nil {
-		log.Fatalf("Failed to connect to MongoDB: %v", err)
-	}
-	defer db.Close()
-
-	fmt.Println("\nProcessing incomplete records...")
-	cursor, err := db.collection.Find(context.Background(), bson.M{
+// FindIncomplete returns userID's products missing a name, image, or
+// specifications.
+func (m *MongoDB) FindIncomplete(ctx context.Context, userID string) ([]*Product, error) {
+	cursor, err := m.collection.Find(ctx, bson.M{
+		"user_id": userID,
 		"$or": []bson.M{
 			{"product_name": ""},
 			{"product_name": bson.M{"$exists": false}},
@@ -239,52 +187,81 @@ func (m *MongoDB) UpdateIncompleteRecords() error {
 		},
 	})
 	if err != nil {
-		log.Fatalf("Error finding incomplete records: %v", err)
+		return nil, fmt.Errorf("error finding incomplete records: %v", err)
 	}
-	defer cursor.Close(context.Background())
+	defer cursor.Close(ctx)
 
-	// Process each incomplete record
-	for cursor.Next(context.Background()) {
+	var products []*Product
+	for cursor.Next(ctx) {
 		var product Product
 		if err := cursor.Decode(&product); err != nil {
-			log.Printf("Error decoding product: %v\n", err)
-			continue
+			return nil, fmt.Errorf("error decoding product: %v", err)
+		}
+		products = append(products, &product)
+	}
+	return products, cursor.Err()
+}
+
+func (m *MongoDB) Close(ctx context.Context) error {
+	return m.client.Disconnect(ctx)
+}
+
+// listAllProducts returns every product across every user. It backs
+// admin-only operations (migrations, cross-user rollups) that aren't part
+// of the per-user Store interface.
+func (m *MongoDB) listAllProducts(ctx context.Context) ([]*Product, error) {
+	cursor, err := m.collection.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find products: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var products []*Product
+	for cursor.Next(ctx) {
+		var product Product
+		if err := cursor.Decode(&product); err != nil {
+			return nil, fmt.Errorf("error decoding product: %v", err)
 		}
+		products = append(products, &product)
+	}
+	return products, cursor.Err()
+}
+
+// UpdatePrices refreshes userID's tracked products concurrently; see
+// refreshPrices for the worker-pool/rate-limit/backoff pipeline.
+func (m *MongoDB) UpdatePrices(ctx context.Context, userID string) error {
+	return m.refreshPrices(ctx, userID, DefaultRefreshConfig)
+}
 
-		url := (product.ProductURL)
-		// var updatedProduct Product
+// UpdateIncompleteRecords re-scrapes userID's products that are missing a
+// name, image, or specifications and upserts the completed record.
+func (m *MongoDB) UpdateIncompleteRecords(ctx context.Context, userID string) error {
+	fmt.Println("\nProcessing incomplete records...")
+	products, err := m.FindIncomplete(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("error finding incomplete records: %v", err)
+	}
 
-		updatedProduct, err := scrapeProductDetails(url)
+	for _, product := range products {
+		url := product.ProductURL
 
+		scraper, err := DefaultRegistry.Lookup(url)
 		if err != nil {
-			log.Printf("Error updating product %s: %v\n", product.ProductURL, err)
+			log.Printf("Unsupported vendor for URL: %s\n", url)
 			continue
 		}
 
-		// Update the product in database
-		err = db.UpsertProduct(updatedProduct)
+		updatedProduct, err := scraper.ScrapeDetails(url)
 		if err != nil {
-			log.Printf("Error updating product %s: %v\n", product.ProductURL, err)
+			log.Printf("Error updating product %s: %v\n", url, err)
 			continue
 		}
-		fmt.Printf("Successfully updated product: %s\n", product.ProductURL)
+
+		if err := m.UpsertProduct(ctx, userID, updatedProduct); err != nil {
+			log.Printf("Error updating product %s: %v\n", url, err)
+			continue
+		}
+		fmt.Printf("Successfully updated product: %s\n", url)
 	}
 	return nil
 }
-
-// Verify updates by getting all products
-// 	fmt.Println("\nVerifying updates...")
-// 	products, err := db.GetAllProducts()
-// 	if err != nil {
-// 		log.Fatalf("Error getting all products: %v", err)
-// 	}
-
-// 	fmt.Printf("\nFound %d products:\n", len(products))
-// 	for i, product := range products {
-// 		fmt.Printf("\n--- Product %d ---\n", i+1)
-// 		fmt.Printf("URL: %s\n", product.ProductURL)
-// 		fmt.Printf("Name: %s\n", product.ProductName)
-// 		fmt.Printf("Image: %s\n", product.ImageURL)
-// 		fmt.Printf("Specifications: %+v\n", product.Specifications)
-// 	}
-// }
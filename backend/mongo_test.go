@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestUpsertProduct(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("upserts by user_id and product_url without reading first", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+
+		db := &MongoDB{collection: mt.Coll}
+		product := &Product{ProductURL: "http://example.com/p", ProductName: "Widget"}
+
+		if err := db.UpsertProduct(context.Background(), "u1", product); err != nil {
+			t.Fatalf("UpsertProduct returned error: %v", err)
+		}
+		if product.UserID != "u1" {
+			t.Fatalf("expected UpsertProduct to stamp UserID, got %q", product.UserID)
+		}
+
+		evt := mt.GetStartedEvent()
+		if evt == nil || evt.CommandName != "update" {
+			t.Fatalf("expected a single update command (no preceding find), got %+v", evt)
+		}
+	})
+}
+
+func TestAddPrice(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("records a raw price point in the prices collection", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+
+		db := &MongoDB{pricesCollection: mt.Coll}
+		if err := db.AddPrice(context.Background(), "http://example.com/p", 42.5); err != nil {
+			t.Fatalf("AddPrice returned error: %v", err)
+		}
+
+		evt := mt.GetStartedEvent()
+		if evt == nil || evt.CommandName != "insert" {
+			t.Fatalf("expected an insert command, got %+v", evt)
+		}
+
+		docs, err := evt.Command.Lookup("documents").Array().Values()
+		if err != nil || len(docs) != 1 {
+			t.Fatalf("expected exactly one inserted document, err=%v docs=%v", err, docs)
+		}
+
+		rec := docs[0].Document()
+		if granularity, ok := rec.Lookup("granularity").StringValueOK(); !ok || granularity != string(GranularityRaw) {
+			t.Fatalf("expected AddPrice to record a raw point, got granularity %q (ok=%v)", granularity, ok)
+		}
+	})
+}
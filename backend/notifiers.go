@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/smtp"
+)
+
+// SMTPNotifier delivers alerts as plain-text emails through an SMTP relay.
+type SMTPNotifier struct {
+	Addr string
+	Auth smtp.Auth
+	From string
+	To   []string
+}
+
+func (n *SMTPNotifier) Notify(ctx context.Context, alert Alert, productName string, price float64) error {
+	body := fmt.Sprintf("Subject: Price alert for %s\r\n\r\n%s is now %.2f (rule %s, threshold %.2f)\r\n",
+		productName, productName, price, alert.RuleType, alert.Threshold)
+	return smtp.SendMail(n.Addr, n.Auth, n.From, n.To, []byte(body))
+}
+
+// TelegramNotifier delivers alerts as messages to a Telegram chat via the
+// bot API.
+type TelegramNotifier struct {
+	BotToken string
+	ChatID   string
+	Client   *http.Client
+}
+
+func (n *TelegramNotifier) Notify(ctx context.Context, alert Alert, productName string, price float64) error {
+	text := fmt.Sprintf("%s is now %.2f (rule %s, threshold %.2f)", productName, price, alert.RuleType, alert.Threshold)
+	payload, err := json.Marshal(map[string]string{"chat_id": n.ChatID, "text": text})
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", n.BotToken)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("telegram notify failed with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (n *TelegramNotifier) client() *http.Client {
+	if n.Client != nil {
+		return n.Client
+	}
+	return http.DefaultClient
+}
+
+// WebhookNotifier delivers alerts as a JSON POST to a generic webhook URL.
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+type webhookPayload struct {
+	RuleType  string  `json:"rule_type"`
+	Threshold float64 `json:"threshold"`
+	Price     float64 `json:"price"`
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, alert Alert, productName string, price float64) error {
+	payload, err := json.Marshal(webhookPayload{
+		RuleType:  string(alert.RuleType),
+		Threshold: alert.Threshold,
+		Price:     price,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook notify failed with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (n *WebhookNotifier) client() *http.Client {
+	if n.Client != nil {
+		return n.Client
+	}
+	return http.DefaultClient
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Granularity controls the resolution returned by GetPriceHistory.
+type Granularity string
+
+const (
+	GranularityRaw    Granularity = "raw"
+	GranularityHourly Granularity = "hourly"
+	GranularityDaily  Granularity = "daily"
+)
+
+// RetentionPolicy controls how long raw price points are kept before being
+// rolled up into hourly buckets by DownsamplePrices.
+type RetentionPolicy struct {
+	// RawRetention is how long raw points survive before downsampling.
+	RawRetention time.Duration
+}
+
+// DefaultRetentionPolicy keeps 30 days of raw points.
+var DefaultRetentionPolicy = RetentionPolicy{RawRetention: 30 * 24 * time.Hour}
+
+// priceRecord is a single point in the "prices" time-series collection,
+// indexed on (product_url, timestamp) so a product's history can be range
+// scanned without loading the rest of the document.
+type priceRecord struct {
+	ProductURL  string      `bson:"product_url"`
+	Timestamp   time.Time   `bson:"timestamp"`
+	Value       float64     `bson:"value"`
+	Granularity Granularity `bson:"granularity"`
+}
+
+// PricePoint is a point returned by GetPriceHistory. For raw granularity,
+// Value is the sampled price; for hourly/daily buckets it's the average and
+// Min/Max bound the bucket.
+type PricePoint struct {
+	Timestamp time.Time `bson:"timestamp"`
+	Value     float64   `bson:"value"`
+	Min       float64   `bson:"min"`
+	Max       float64   `bson:"max"`
+}
+
+func newPricesCollection(ctx context.Context, database *mongo.Database) (MongoCollection, error) {
+	collection := database.Collection("prices")
+	_, err := collection.Indexes().CreateOne(
+		ctx,
+		mongo.IndexModel{
+			Keys: bson.D{
+				{Key: "product_url", Value: 1},
+				{Key: "timestamp", Value: 1},
+			},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return collection, nil
+}
+
+// GetPriceHistory returns the price points for productURL between from and
+// to at the requested granularity. Raw points are read directly; hourly and
+// daily granularities aggregate min/max/avg buckets over that window. Only
+// raw points are read: hourly buckets that DownsamplePrices stored in place
+// of older raw points are not returned.
+func (m *MongoDB) GetPriceHistory(ctx context.Context, productURL string, from, to time.Time, granularity Granularity) ([]PricePoint, error) {
+	if granularity == GranularityRaw {
+		cursor, err := m.pricesCollection.Find(ctx, bson.M{
+			"product_url": productURL,
+			"granularity": GranularityRaw,
+			"timestamp":   bson.M{"$gte": from, "$lte": to},
+		}, options.Find().SetSort(bson.D{{Key: "timestamp", Value: 1}}))
+		if err != nil {
+			return nil, fmt.Errorf("failed to find price history: %v", err)
+		}
+		defer cursor.Close(ctx)
+
+		var points []PricePoint
+		for cursor.Next(ctx) {
+			var rec priceRecord
+			if err := cursor.Decode(&rec); err != nil {
+				return nil, fmt.Errorf("error decoding price point: %v", err)
+			}
+			points = append(points, PricePoint{Timestamp: rec.Timestamp, Value: rec.Value, Min: rec.Value, Max: rec.Value})
+		}
+		return points, cursor.Err()
+	}
+
+	return m.aggregatePriceHistory(ctx, productURL, from, to, granularity)
+}
+
+// aggregatePriceHistory buckets raw points into hourly or daily min/max/avg
+// windows in memory, so charts only pull the resolution they actually need
+// instead of every raw sample.
+func (m *MongoDB) aggregatePriceHistory(ctx context.Context, productURL string, from, to time.Time, granularity Granularity) ([]PricePoint, error) {
+	// Bucket from raw points only: aggregating over records that are
+	// themselves already-rolled-up buckets would re-average averages.
+	cursor, err := m.pricesCollection.Find(ctx, bson.M{
+		"product_url": productURL,
+		"granularity": GranularityRaw,
+		"timestamp":   bson.M{"$gte": from, "$lte": to},
+	}, options.Find().SetSort(bson.D{{Key: "timestamp", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to find price history: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	type bucket struct {
+		key      string
+		min, max float64
+		sum      float64
+		count    int
+		start    time.Time
+	}
+	buckets := make(map[string]*bucket)
+	var order []string
+
+	for cursor.Next(ctx) {
+		var rec priceRecord
+		if err := cursor.Decode(&rec); err != nil {
+			return nil, fmt.Errorf("error decoding price point: %v", err)
+		}
+
+		var key string
+		if granularity == GranularityDaily {
+			key = rec.Timestamp.Format("2006-01-02")
+		} else {
+			key = rec.Timestamp.Format("2006-01-02T15")
+		}
+
+		b, ok := buckets[key]
+		if !ok {
+			b = &bucket{key: key, min: rec.Value, max: rec.Value, start: rec.Timestamp}
+			buckets[key] = b
+			order = append(order, key)
+		}
+		if rec.Value < b.min {
+			b.min = rec.Value
+		}
+		if rec.Value > b.max {
+			b.max = rec.Value
+		}
+		b.sum += rec.Value
+		b.count++
+	}
+
+	points := make([]PricePoint, 0, len(order))
+	for _, key := range order {
+		b := buckets[key]
+		points = append(points, PricePoint{
+			Timestamp: b.start,
+			Value:     b.sum / float64(b.count),
+			Min:       b.min,
+			Max:       b.max,
+		})
+	}
+	return points, nil
+}
+
+// DownsamplePrices rolls up raw points older than policy.RawRetention into
+// hourly buckets and deletes the raw points they were built from, keeping
+// the prices collection bounded for long-lived trackers.
+func (m *MongoDB) DownsamplePrices(ctx context.Context, productURL string, policy RetentionPolicy) error {
+	cutoff := time.Now().Add(-policy.RawRetention)
+
+	points, err := m.GetPriceHistory(ctx, productURL, time.Time{}, cutoff, GranularityHourly)
+	if err != nil {
+		return fmt.Errorf("failed to bucket old price points: %v", err)
+	}
+
+	for _, p := range points {
+		rec := priceRecord{ProductURL: productURL, Timestamp: p.Timestamp, Value: p.Value, Granularity: GranularityHourly}
+		if _, err := m.pricesCollection.InsertOne(ctx, rec); err != nil {
+			return fmt.Errorf("failed to insert downsampled bucket: %v", err)
+		}
+	}
+
+	_, err = m.pricesCollection.DeleteMany(ctx, bson.M{
+		"product_url": productURL,
+		"granularity": GranularityRaw,
+		"timestamp":   bson.M{"$lte": cutoff},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete downsampled raw points: %v", err)
+	}
+
+	return nil
+}
+
+// MigratePriceHistory is a one-shot migration that reads each product's
+// embedded PriceHistory array and rewrites the points into the "prices"
+// time-series collection, then clears the embedded array so it stops
+// growing unboundedly inside the product document.
+func (m *MongoDB) MigratePriceHistory(ctx context.Context) error {
+	products, err := m.listAllProducts(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list products for migration: %v", err)
+	}
+
+	for _, product := range products {
+		for _, p := range product.PriceHistory {
+			rec := priceRecord{ProductURL: product.ProductURL, Timestamp: p.Timestamp, Value: p.Value, Granularity: GranularityRaw}
+			if _, err := m.pricesCollection.InsertOne(ctx, rec); err != nil {
+				return fmt.Errorf("failed to migrate price point for %s: %v", product.ProductURL, err)
+			}
+		}
+
+		_, err := m.collection.UpdateOne(ctx,
+			bson.M{"user_id": product.UserID, "product_url": product.ProductURL},
+			bson.M{"$unset": bson.M{"price_history": ""}},
+		)
+		if err != nil {
+			return fmt.Errorf("failed to clear embedded price history for %s: %v", product.ProductURL, err)
+		}
+	}
+
+	return nil
+}
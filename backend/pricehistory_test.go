@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// TestGetPriceHistoryScopesByGranularity guards the raw/granularity-scoping
+// bug fixed in 3373ce0: both the raw-read path and aggregatePriceHistory
+// must filter on granularity: raw, or a downsampled bucket would get
+// re-averaged into later reads.
+func TestGetPriceHistoryScopesByGranularity(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("raw request filters on raw granularity", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "price_tracker.prices", mtest.FirstBatch))
+
+		db := &MongoDB{pricesCollection: mt.Coll}
+		_, err := db.GetPriceHistory(context.Background(), "http://example.com/p", time.Now().Add(-time.Hour), time.Now(), GranularityRaw)
+		if err != nil {
+			t.Fatalf("GetPriceHistory returned error: %v", err)
+		}
+
+		assertFilteredToRawGranularity(t, mt)
+	})
+
+	mt.Run("hourly request aggregates raw points only", func(mt *mtest.T) {
+		// Both points are pinned to the same hour (":00" and ":01") rather
+		// than derived from time.Now(), since aggregatePriceHistory keys
+		// buckets by calendar hour and a wall-clock-derived 30-minute offset
+		// would flakily land in the next hour bucket past the :30 mark.
+		hour := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "price_tracker.prices", mtest.FirstBatch,
+			bson.D{
+				{Key: "product_url", Value: "http://example.com/p"},
+				{Key: "timestamp", Value: hour},
+				{Key: "value", Value: 10.0},
+				{Key: "granularity", Value: string(GranularityRaw)},
+			},
+			bson.D{
+				{Key: "product_url", Value: "http://example.com/p"},
+				{Key: "timestamp", Value: hour.Add(time.Minute)},
+				{Key: "value", Value: 20.0},
+				{Key: "granularity", Value: string(GranularityRaw)},
+			},
+		))
+
+		db := &MongoDB{pricesCollection: mt.Coll}
+		points, err := db.GetPriceHistory(context.Background(), "http://example.com/p", hour.Add(-time.Hour), hour.Add(time.Hour), GranularityHourly)
+		if err != nil {
+			t.Fatalf("GetPriceHistory returned error: %v", err)
+		}
+		if len(points) != 1 {
+			t.Fatalf("expected both points bucketed into a single hour, got %+v", points)
+		}
+		if points[0].Min != 10.0 || points[0].Max != 20.0 || points[0].Value != 15.0 {
+			t.Fatalf("expected min/max/avg of 10/20/15, got %+v", points[0])
+		}
+
+		assertFilteredToRawGranularity(t, mt)
+	})
+}
+
+// assertFilteredToRawGranularity checks the most recently sent find command
+// scoped its filter to granularity: raw, so aggregation never re-averages
+// already-rolled-up buckets.
+func assertFilteredToRawGranularity(t *testing.T, mt *mtest.T) {
+	t.Helper()
+
+	evt := mt.GetStartedEvent()
+	if evt == nil || evt.CommandName != "find" {
+		t.Fatalf("expected a find command to have been sent, got %+v", evt)
+	}
+
+	filter, err := evt.Command.Lookup("filter").Document().LookupErr("granularity")
+	if err != nil {
+		t.Fatalf("find filter is missing a granularity constraint: %v", evt.Command)
+	}
+	if filter.StringValue() != string(GranularityRaw) {
+		t.Fatalf("expected find filter to scope to granularity %q, got %q", GranularityRaw, filter.StringValue())
+	}
+}
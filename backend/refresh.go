@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/time/rate"
+)
+
+// RefreshConfig tunes the concurrent pipeline refreshPrices runs.
+type RefreshConfig struct {
+	// Workers is how many goroutines scrape prices concurrently.
+	Workers int
+	// VendorQPS caps requests per second per vendor (see Scraper.VendorName).
+	// Vendors not listed default to 1 req/s.
+	VendorQPS map[string]float64
+	// MaxRetries is how many times a 429/503 response is retried with backoff.
+	MaxRetries int
+}
+
+// DefaultRefreshConfig is a conservative default for UpdatePrices.
+var DefaultRefreshConfig = RefreshConfig{
+	Workers:    8,
+	VendorQPS:  map[string]float64{"flipkart": 2, "amazon": 2},
+	MaxRetries: 3,
+}
+
+// priceUpdate is what a worker hands the collector after a successful scrape.
+type priceUpdate struct {
+	userID      string
+	productURL  string
+	productName string
+	price       float64
+}
+
+// vendorLimiters lazily creates and caches a rate.Limiter per vendor so
+// concurrent workers targeting the same vendor share one QPS budget.
+type vendorLimiters struct {
+	mu       sync.Mutex
+	cfg      RefreshConfig
+	limiters map[string]*rate.Limiter
+}
+
+func newVendorLimiters(cfg RefreshConfig) *vendorLimiters {
+	return &vendorLimiters{cfg: cfg, limiters: make(map[string]*rate.Limiter)}
+}
+
+func (v *vendorLimiters) forVendor(vendor string) *rate.Limiter {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if l, ok := v.limiters[vendor]; ok {
+		return l
+	}
+
+	qps := v.cfg.VendorQPS[vendor]
+	if qps <= 0 {
+		qps = 1
+	}
+	l := rate.NewLimiter(rate.Limit(qps), 1)
+	v.limiters[vendor] = l
+	return l
+}
+
+// refreshPrices runs a producer/worker-pool/collector pipeline over every
+// product userID tracks: a producer streams products into a job channel, workers
+// scrape prices (rate limited and retried per vendor), and a collector
+// batches the results into the prices collection with BulkWrite. The whole
+// run honors ctx so a cancellation (e.g. SIGINT) stops in-flight scrapes; a
+// BulkWrite failure cancels the derived pipeline context itself, so workers
+// blocked on results <- update don't leak.
+func (m *MongoDB) refreshPrices(ctx context.Context, userID string, cfg RefreshConfig) error {
+	products, err := m.ListProducts(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	pipelineCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan *Product)
+	results := make(chan priceUpdate)
+	limiters := newVendorLimiters(cfg)
+
+	var workers sync.WaitGroup
+	for i := 0; i < cfg.Workers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			m.scrapeWorker(pipelineCtx, userID, jobs, results, limiters, cfg.MaxRetries)
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		for _, product := range products {
+			select {
+			case jobs <- product:
+			case <-pipelineCtx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		workers.Wait()
+		close(results)
+	}()
+
+	return m.collectPriceUpdates(pipelineCtx, cancel, results)
+}
+
+// scrapeWorker pulls products off jobs until it's closed, rate-limits and
+// retries the scrape per vendor, and forwards successes to results.
+func (m *MongoDB) scrapeWorker(ctx context.Context, userID string, jobs <-chan *Product, results chan<- priceUpdate, limiters *vendorLimiters, maxRetries int) {
+	for product := range jobs {
+		scraper, err := DefaultRegistry.Lookup(product.ProductURL)
+		if err != nil {
+			log.Printf("Unsupported vendor for URL: %s\n", product.ProductURL)
+			continue
+		}
+
+		if err := limiters.forVendor(scraper.VendorName()).Wait(ctx); err != nil {
+			return
+		}
+
+		price, err := scrapeWithBackoff(ctx, scraper, product.ProductURL, maxRetries)
+		if err != nil {
+			log.Printf("Error scraping %s price for %s: %v\n", scraper.VendorName(), product.ProductURL, err)
+			continue
+		}
+
+		update := priceUpdate{userID: userID, productURL: product.ProductURL, productName: product.ProductName, price: price}
+		select {
+		case results <- update:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// collectPriceUpdates batches scraped prices into the prices collection via
+// BulkWrite instead of one round trip per product. On a BulkWrite failure it
+// cancels the pipeline (via cancel) so producer/workers stop, but keeps
+// ranging over results until the workers close it instead of returning
+// immediately — returning early would leave any worker blocked on
+// results <- update stuck forever.
+func (m *MongoDB) collectPriceUpdates(ctx context.Context, cancel context.CancelFunc, results <-chan priceUpdate) error {
+	const batchSize = 50
+	var models []mongo.WriteModel
+	var firstErr error
+
+	flush := func() error {
+		if len(models) == 0 {
+			return nil
+		}
+		if _, err := m.pricesCollection.BulkWrite(ctx, models); err != nil {
+			return fmt.Errorf("failed to bulk write price updates: %v", err)
+		}
+		models = models[:0]
+		return nil
+	}
+
+	for update := range results {
+		if firstErr != nil {
+			// Draining after a write failure: the pipeline is already
+			// canceled, just let workers unblock and exit.
+			continue
+		}
+
+		rec := priceRecord{
+			ProductURL:  update.productURL,
+			Value:       update.price,
+			Timestamp:   time.Now(),
+			Granularity: GranularityRaw,
+		}
+		models = append(models, mongo.NewInsertOneModel().SetDocument(rec))
+		fmt.Printf("Updated price for %s: %.2f\n", update.productName, update.price)
+
+		if m.alertEvaluator != nil {
+			if err := m.alertEvaluator.Evaluate(ctx, update.userID, update.productURL, update.productName, update.price); err != nil {
+				log.Printf("Error evaluating alerts for %s: %v\n", update.productURL, err)
+			}
+		}
+
+		if len(models) >= batchSize {
+			if err := flush(); err != nil {
+				firstErr = err
+				cancel()
+			}
+		}
+	}
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return flush()
+}
+
+// scrapeWithBackoff calls scraper.ScrapePrice, retrying with exponential
+// backoff and jitter when the vendor responds 429/503, up to maxRetries times.
+func scrapeWithBackoff(ctx context.Context, scraper Scraper, url string, maxRetries int) (float64, error) {
+	var lastErr error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		price, err := scraper.ScrapePrice(url)
+		if err == nil {
+			return price, nil
+		}
+		lastErr = err
+		if !isRetryableScrapeError(err) || attempt == maxRetries {
+			break
+		}
+
+		backoff := time.Duration(1<<uint(attempt)) * 500 * time.Millisecond
+		jitter := time.Duration(rand.Int63n(int64(backoff)/2 + 1))
+		select {
+		case <-time.After(backoff + jitter):
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+	return 0, lastErr
+}
+
+// isRetryableScrapeError reports whether a scrape error looks like a
+// transient vendor-side rate limit or outage worth retrying.
+func isRetryableScrapeError(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "429") || strings.Contains(msg, "503")
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// TestCollectPriceUpdatesCancelsOnBulkWriteFailure guards the fix in 86fcdfd:
+// a BulkWrite failure must cancel the pipeline so scrapeWorker goroutines
+// blocked on results <- update unblock, instead of collectPriceUpdates
+// returning immediately and leaking them forever.
+func TestCollectPriceUpdatesCancelsOnBulkWriteFailure(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+
+	mt.Run("BulkWrite failure unblocks workers instead of leaking them", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateWriteErrorsResponse(mtest.WriteError{
+			Index:   0,
+			Code:    11000,
+			Message: "forced failure",
+		}))
+
+		db := &MongoDB{pricesCollection: mt.Coll}
+		ctx, cancel := context.WithCancel(context.Background())
+
+		results := make(chan priceUpdate)
+
+		// Simulate scrapeWorker: several goroutines racing to send more than
+		// batchSize updates, each selecting on ctx.Done() exactly like the
+		// real worker does.
+		const workerCount = 3
+		var workers sync.WaitGroup
+		for i := 0; i < workerCount; i++ {
+			workers.Add(1)
+			go func() {
+				defer workers.Done()
+				for j := 0; j < 30; j++ {
+					select {
+					case results <- priceUpdate{productURL: "http://example.com/p", price: float64(j)}:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+		}
+
+		workersDone := make(chan struct{})
+		go func() {
+			workers.Wait()
+			close(results)
+			close(workersDone)
+		}()
+
+		collectDone := make(chan error, 1)
+		go func() {
+			collectDone <- db.collectPriceUpdates(ctx, cancel, results)
+		}()
+
+		select {
+		case err := <-collectDone:
+			if err == nil {
+				t.Fatalf("expected collectPriceUpdates to return the BulkWrite error")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("collectPriceUpdates did not return after a BulkWrite failure")
+		}
+
+		select {
+		case <-workersDone:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("worker goroutines stayed blocked on results <- update after the pipeline was canceled")
+		}
+	})
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Scraper knows how to recognize and pull data for a single vendor's product
+// pages. Implementations are registered against a ScraperRegistry at init
+// time so new vendors can be added without touching the update loops.
+type Scraper interface {
+	// Matches reports whether this scraper handles the given product URL.
+	Matches(url string) bool
+	// ScrapeDetails fetches the full product record (name, image,
+	// specifications) for url.
+	ScrapeDetails(url string) (*Product, error)
+	// ScrapePrice fetches the current price for url.
+	ScrapePrice(url string) (float64, error)
+	// VendorName identifies the vendor for logging/metrics.
+	VendorName() string
+}
+
+// ScraperRegistry dispatches a product URL to the Scraper that claims it.
+type ScraperRegistry struct {
+	scrapers []Scraper
+}
+
+// NewScraperRegistry returns an empty registry ready for Register calls.
+func NewScraperRegistry() *ScraperRegistry {
+	return &ScraperRegistry{}
+}
+
+// Register adds a Scraper to the registry. Later registrations are only
+// consulted if earlier ones don't match, so order matters when URL patterns
+// could overlap.
+func (r *ScraperRegistry) Register(s Scraper) {
+	r.scrapers = append(r.scrapers, s)
+}
+
+// Lookup returns the Scraper that handles url, or an error if no registered
+// vendor matches.
+func (r *ScraperRegistry) Lookup(url string) (Scraper, error) {
+	for _, s := range r.scrapers {
+		if s.Matches(url) {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("no scraper registered for URL: %s", url)
+}
+
+// DefaultRegistry is the registry used by MongoDB's update loops. The vendor
+// adapters below are registered against it in this file's init function.
+var DefaultRegistry = NewScraperRegistry()
+
+// flipkartScraper adapts the existing Flipkart scrape functions to the
+// Scraper interface.
+type flipkartScraper struct{}
+
+func (flipkartScraper) Matches(url string) bool {
+	return strings.Contains(url, "flipkart")
+}
+
+func (flipkartScraper) VendorName() string { return "flipkart" }
+
+func (flipkartScraper) ScrapeDetails(url string) (*Product, error) {
+	return scrapeProductDetails(url)
+}
+
+func (flipkartScraper) ScrapePrice(url string) (float64, error) {
+	priceStr, err := ScrapePriceFlipkart(url)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(priceStr, 64)
+}
+
+// amazonScraper adapts the existing Amazon scrape functions to the Scraper
+// interface.
+type amazonScraper struct{}
+
+func (amazonScraper) Matches(url string) bool {
+	return strings.Contains(url, "amazon")
+}
+
+func (amazonScraper) VendorName() string { return "amazon" }
+
+func (amazonScraper) ScrapeDetails(url string) (*Product, error) {
+	return scrapeProductDetails(url)
+}
+
+func (amazonScraper) ScrapePrice(url string) (float64, error) {
+	priceStr, err := ScrapePriceAmazon(url)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(priceStr, 64)
+}
+
+func init() {
+	DefaultRegistry.Register(flipkartScraper{})
+	DefaultRegistry.Register(amazonScraper{})
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoCollection is the subset of *mongo.Collection's behavior that Store
+// implementations depend on. It exists so tests can substitute a fake
+// collection instead of talking to a live MongoDB instance.
+type MongoCollection interface {
+	InsertOne(ctx context.Context, document interface{}, opts ...*options.InsertOneOptions) (*mongo.InsertOneResult, error)
+	FindOne(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) *mongo.SingleResult
+	UpdateOne(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error)
+	Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (*mongo.Cursor, error)
+	BulkWrite(ctx context.Context, models []mongo.WriteModel, opts ...*options.BulkWriteOptions) (*mongo.BulkWriteResult, error)
+	DeleteMany(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error)
+}
+
+// Store is the persistence seam used by the update loops. MongoDB is the
+// production implementation; tests can supply a fake backed by an in-memory
+// MongoCollection.
+type Store interface {
+	UpsertProduct(ctx context.Context, userID string, product *Product) error
+	AddPrice(ctx context.Context, productURL string, price float64) error
+	GetProduct(ctx context.Context, userID, productURL string) (*Product, error)
+	ListProducts(ctx context.Context, userID string) ([]*Product, error)
+	FindIncomplete(ctx context.Context, userID string) ([]*Product, error)
+	GetPriceHistory(ctx context.Context, productURL string, from, to time.Time, granularity Granularity) ([]PricePoint, error)
+}
+
+var _ Store = (*MongoDB)(nil)
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// User holds auth metadata for a tracker account. Product ownership is
+// expressed by Product.UserID, not by a per-user collection.
+type User struct {
+	Username string `bson:"username"`
+}
+
+func newUsersCollection(ctx context.Context, database *mongo.Database) (MongoCollection, error) {
+	collection := database.Collection("users")
+	_, err := collection.Indexes().CreateOne(
+		ctx,
+		mongo.IndexModel{
+			Keys:    bson.D{{Key: "username", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return collection, nil
+}
+
+// reservedCollections are the shared collections this store owns; any other
+// collection found in the database is assumed to be a legacy per-username
+// products collection from before the multi-tenant migration.
+var reservedCollections = map[string]bool{
+	"products": true,
+	"users":    true,
+	"prices":   true,
+	"alerts":   true,
+}
+
+// MigrateToMultiTenant copies documents out of legacy per-username
+// collections (NewMongoDB used to name the products collection after the
+// username) into the unified "products" collection, deriving each
+// product's user_id from the collection it came from.
+func (m *MongoDB) MigrateToMultiTenant(ctx context.Context) error {
+	names, err := m.database.ListCollectionNames(ctx, bson.M{})
+	if err != nil {
+		return fmt.Errorf("failed to list collections: %v", err)
+	}
+
+	for _, name := range names {
+		if reservedCollections[name] || strings.HasPrefix(name, "system.") {
+			continue
+		}
+
+		userID := name
+		legacy := m.database.Collection(name)
+
+		cursor, err := legacy.Find(ctx, bson.M{})
+		if err != nil {
+			return fmt.Errorf("failed to read legacy collection %s: %v", name, err)
+		}
+
+		for cursor.Next(ctx) {
+			var product Product
+			if err := cursor.Decode(&product); err != nil {
+				cursor.Close(ctx)
+				return fmt.Errorf("error decoding legacy product in %s: %v", name, err)
+			}
+
+			if err := m.UpsertProduct(ctx, userID, &product); err != nil {
+				cursor.Close(ctx)
+				return fmt.Errorf("failed to migrate product %s for user %s: %v", product.ProductURL, userID, err)
+			}
+		}
+		err = cursor.Err()
+		cursor.Close(ctx)
+		if err != nil {
+			return fmt.Errorf("error reading legacy collection %s: %v", name, err)
+		}
+
+		fmt.Printf("Migrated legacy collection %q into products for user_id=%q\n", name, userID)
+	}
+
+	return nil
+}